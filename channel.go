@@ -191,6 +191,10 @@ type Channel struct {
 		l            net.Listener  // May be nil if this is a client only channel
 		idleSweep    *idleSweep
 		conns        map[uint32]*Connection
+
+		// relayHostPorts is the set of host:ports the channel is reachable on
+		// locally, used by relays to detect calls routed back to themselves.
+		relayHostPorts map[string]struct{}
 	}
 }
 
@@ -365,6 +369,9 @@ func (ch *Channel) Serve(l net.Listener) error {
 
 	mutable.peerInfo.HostPort = l.Addr().String()
 	mutable.peerInfo.IsEphemeral = false
+	if ch.relayHost != nil {
+		mutable.relayHostPorts = localHostPorts(mutable.peerInfo.HostPort)
+	}
 	ch.log = ch.log.WithFields(LogField{"hostPort", mutable.peerInfo.HostPort})
 	ch.log.Info("Channel is listening.")
 	go ch.serve()
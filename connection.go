@@ -221,6 +221,9 @@ type Connection struct {
 	// idle for the recieve and send connections respectively. (unix time, nano)
 	lastActivityRead  atomic.Int64
 	lastActivityWrite atomic.Int64
+
+	// creationTime is when the connection was created. (unix time, nano)
+	creationTime int64
 }
 
 type peerAddressComponents struct {
@@ -348,6 +351,7 @@ func (ch *Channel) newConnection(baseCtx context.Context, conn net.Conn, initial
 		healthCheckHistory: newHealthHistory(),
 		lastActivityRead:   *atomic.NewInt64(timeNow),
 		lastActivityWrite:  *atomic.NewInt64(timeNow),
+		creationTime:       timeNow,
 		baseContext:        ch.connContext(baseCtx, conn),
 	}
 
@@ -588,6 +592,7 @@ func (c *Connection) connectionError(site string, err error) error {
 	if c.stoppedExchanges.CAS(false, true) {
 		c.outbound.stopExchanges(err)
 		c.inbound.stopExchanges(err)
+		c.relay.failRelayItems(err)
 	}
 
 	// checkExchanges will close the connection due to stoppedExchanges.
@@ -609,6 +614,7 @@ func (c *Connection) protocolError(id uint32, err error) error {
 	if c.stoppedExchanges.CAS(false, true) {
 		c.outbound.stopExchanges(sysErr)
 		c.inbound.stopExchanges(sysErr)
+		c.relay.failRelayItems(sysErr)
 	}
 	return sysErr
 }
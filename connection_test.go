@@ -1156,6 +1156,9 @@ func TestLastActivityTime(t *testing.T) {
 	opts := testutils.NewOpts().SetTimeNow(clock.Now)
 
 	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		// The clock is shared across test server runs, so connections are
+		// created at the time the run starts rather than at initialTime.
+		createdTime := clock.Now().UnixNano()
 		client := ts.NewClient(opts)
 		server := ts.Server()
 
@@ -1177,6 +1180,10 @@ func TestLastActivityTime(t *testing.T) {
 			assert.Equal(t, respTime, clientConn.LastActivityRead)
 			assert.Equal(t, respTime, serverConn.LastActivityWrite)
 
+			// The creation time should not change as the last activity times do.
+			assert.Equal(t, createdTime, clientConn.CreationTime)
+			assert.Equal(t, createdTime, serverConn.CreationTime)
+
 			// Relays should act like both clients and servers.
 			if ts.HasRelay() {
 				relayInbound := getConnection(t, ts.Relay(), inbound)
@@ -1187,6 +1194,9 @@ func TestLastActivityTime(t *testing.T) {
 
 				assert.Equal(t, respTime, relayInbound.LastActivityWrite)
 				assert.Equal(t, respTime, relayOutbound.LastActivityRead)
+
+				assert.Equal(t, createdTime, relayInbound.CreationTime)
+				assert.Equal(t, createdTime, relayOutbound.CreationTime)
 			}
 		}
 
@@ -1259,12 +1269,14 @@ func TestLastActivityTimePings(t *testing.T) {
 			clientConn := getConnection(t, client, outbound)
 			assert.Equal(t, timeAtStart, clientConn.LastActivityRead)
 			assert.Equal(t, timeAtStart, clientConn.LastActivityWrite)
+			assert.Equal(t, timeAtStart, clientConn.CreationTime)
 
 			// Relays do not pass pings on to the server.
 			if ts.HasRelay() {
 				relayInbound := getConnection(t, ts.Relay(), inbound)
 				assert.Equal(t, timeAtStart, relayInbound.LastActivityRead)
 				assert.Equal(t, timeAtStart, relayInbound.LastActivityWrite)
+				assert.Equal(t, timeAtStart, relayInbound.CreationTime)
 			}
 
 			serverConn := getConnection(t, ts.Server(), inbound)
@@ -157,6 +157,7 @@ type ConnectionRuntimeState struct {
 	HealthChecks      []bool                  `json:"healthChecks,omitempty"`
 	LastActivityRead  int64                   `json:"lastActivityRead"`
 	LastActivityWrite int64                   `json:"lastActivityWrite"`
+	CreationTime      int64                   `json:"creationTime"`
 	SendChQueued      int                     `json:"sendChQueued"`
 	SendChCapacity    int                     `json:"sendChCapacity"`
 	SendBufferUsage   int                     `json:"sendBufferUsage"`
@@ -374,6 +375,7 @@ func (c *Connection) IntrospectState(opts *IntrospectionOptions) ConnectionRunti
 		HealthChecks:      c.healthCheckHistory.asBools(),
 		LastActivityRead:  c.lastActivityRead.Load(),
 		LastActivityWrite: c.lastActivityWrite.Load(),
+		CreationTime:      c.creationTime,
 		SendChQueued:      len(c.sendCh),
 		SendChCapacity:    cap(c.sendCh),
 		SendBufferUsage:   sendBufUsage,
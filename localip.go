@@ -94,6 +94,36 @@ func ListenIP() (net.IP, error) {
 	return listenIP(interfaces)
 }
 
+// localHostPorts returns the set of host:ports that reach a listener on hostPort
+// from this machine. If hostPort uses an unspecified IP (e.g. "[::]:4040"), the
+// set includes the port on the loopback, unspecified and local interface
+// addresses. Interface addresses are only read once, so addresses added later
+// are not included, and host names are never resolved.
+func localHostPorts(hostPort string) map[string]struct{} {
+	hostPorts := map[string]struct{}{hostPort: {}}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPorts
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+		return hostPorts
+	}
+
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback, net.IPv4zero, net.IPv6unspecified}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	for _, ip := range ips {
+		hostPorts[net.JoinHostPort(ip.String(), port)] = struct{}{}
+	}
+	return hostPorts
+}
+
 func mustParseMAC(s string) net.HardwareAddr {
 	addr, err := net.ParseMAC(s)
 	if err != nil {
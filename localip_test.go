@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestScoreAddr(t *testing.T) {
@@ -100,3 +101,51 @@ func TestScoreAddr(t *testing.T) {
 		assert.Equal(t, tt.wantIP, gotIP, tt.msg)
 	}
 }
+
+func TestLocalHostPorts(t *testing.T) {
+	listenIP, err := ListenIP()
+	require.NoError(t, err, "ListenIP failed")
+
+	tests := []struct {
+		hostPort string
+		want     []string
+		notWant  []string
+	}{
+		{
+			hostPort: "10.0.0.1:4040",
+			want:     []string{"10.0.0.1:4040"},
+			notWant:  []string{"127.0.0.1:4040", "0.0.0.0:4040"},
+		},
+		{
+			hostPort: "0.0.0.0:4040",
+			want: []string{
+				"0.0.0.0:4040",
+				"127.0.0.1:4040",
+				"[::1]:4040",
+				"[::]:4040",
+				net.JoinHostPort(listenIP.String(), "4040"),
+			},
+			// Reserved for documentation (RFC 5737), so never assigned to an interface.
+			notWant: []string{"192.0.2.1:4040", "127.0.0.1:4041"},
+		},
+		{
+			hostPort: "[::]:4040",
+			want:     []string{"[::]:4040", "127.0.0.1:4040", net.JoinHostPort(listenIP.String(), "4040")},
+		},
+		{
+			hostPort: "localhost:4040",
+			want:     []string{"localhost:4040"},
+			notWant:  []string{"127.0.0.1:4040"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := localHostPorts(tt.hostPort)
+		for _, hp := range tt.want {
+			assert.Contains(t, got, hp, "localHostPorts(%v) missing %v", tt.hostPort, hp)
+		}
+		for _, hp := range tt.notWant {
+			assert.NotContains(t, got, hp, "localHostPorts(%v) should not contain %v", tt.hostPort, hp)
+		}
+	}
+}
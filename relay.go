@@ -47,10 +47,12 @@ const (
 
 // Error strings.
 const (
-	_relayErrorNotFound       = "relay-not-found"
-	_relayErrorDestConnSlow   = "relay-dest-conn-slow"
-	_relayErrorSourceConnSlow = "relay-source-conn-slow"
-	_relayArg2ModifyFailed    = "relay-arg2-modify-failed"
+	_relayErrorNotFound         = "relay-not-found"
+	_relayErrorDestConnSlow     = "relay-dest-conn-slow"
+	_relayErrorSourceConnSlow   = "relay-source-conn-slow"
+	_relayErrorDestConnFailed   = "relay-dest-conn-failed"
+	_relayErrorSourceConnFailed = "relay-source-conn-failed"
+	_relayArg2ModifyFailed      = "relay-arg2-modify-failed"
 
 	// _relayNoRelease indicates that the relayed frame should not be released immediately, since
 	// relayed frames normally end up in a send queue where it is released afterward. However in some
@@ -64,7 +66,9 @@ const (
 var (
 	errRelayMethodFragmented    = NewSystemError(ErrCodeBadRequest, "relay handler cannot receive fragmented calls")
 	errFrameNotSent             = NewSystemError(ErrCodeNetwork, "frame was not sent to remote side")
+	errContinuationNotSent      = NewSystemError(ErrCodeUnexpected, "frame was not sent to remote side")
 	errBadRelayHost             = NewSystemError(ErrCodeDeclined, "bad relay host implementation")
+	errRelayLoop                = NewSystemError(ErrCodeDeclined, "relay loop detected")
 	errUnknownID                = errors.New("non-callReq for inactive ID")
 	errNoNHInArg2               = errors.New("no nh in arg2")
 	errFragmentedArg2WithAppend = errors.New("fragmented arg2 not supported for appends")
@@ -142,10 +146,25 @@ func (r *relayItems) Get(id uint32, stopTimeout bool) (_ relayItem, stopped bool
 	return item, item.timeout.Stop(), true /* found */
 }
 
-// Add adds a relay item.
-func (r *relayItems) Add(id uint32, item relayItem) {
+// IDs returns the IDs of all non-tombstone items.
+func (r *relayItems) IDs() []uint32 {
+	r.RLock()
+	ids := make([]uint32, 0, len(r.items)-int(r.tombs))
+	for id, item := range r.items {
+		if !item.tomb {
+			ids = append(ids, id)
+		}
+	}
+	r.RUnlock()
+	return ids
+}
+
+// Add adds a relay item and starts its timeout. The timeout is started with
+// the lock held so the item is never visible with an unstarted timer.
+func (r *relayItems) Add(id uint32, item relayItem, ttl time.Duration) {
 	r.Lock()
 	r.items[id] = item
+	item.timeout.Start(ttl, r, id, item.isOriginator)
 	r.Unlock()
 }
 
@@ -210,6 +229,23 @@ const (
 )
 
 // A Relayer forwards frames.
+//
+// Error frames from the destination are forwarded with their original code.
+// Errors originated by the relay itself use the following codes:
+//   - the code of any SystemError returned by RelayHost.Start, and
+//     ErrCodeDeclined for any other error or if no peer was selected.
+//   - ErrCodeDeclined if the caller's connection is no longer active, or the
+//     selected peer is the relay's own host:port (see localHostPorts).
+//   - errors connecting to the selected peer keep their code if they are
+//     SystemErrors (e.g. ErrCodeTimeout if the connect times out, or
+//     ErrCodeCancelled if it is cancelled), and use ErrCodeNetwork otherwise.
+//   - ErrCodeNetwork if the peer's connection is not active, the callReq could
+//     not be forwarded, or the destination connection failed while the call
+//     was in flight.
+//   - ErrCodeUnexpected if a frame after the callReq could not be forwarded,
+//     since the destination may already be handling the call, or if arg2
+//     could not be modified (relay-arg2-modify-failed).
+//   - ErrCodeTimeout if the call exceeds its TTL.
 type Relayer struct {
 	relayHost      RelayHost
 	maxTimeout     time.Duration
@@ -233,6 +269,10 @@ type Relayer struct {
 	// It allows timer re-use, while allowing timers to be created and started separately.
 	timeouts *relayTimerPool
 
+	// localHostPorts is the set of host:ports that reach the relay itself, computed
+	// when the channel starts listening. It's empty for connections created before.
+	localHostPorts map[string]struct{}
+
 	peers     *RootPeerList
 	conn      *Connection
 	relayConn *relay.Conn
@@ -242,6 +282,10 @@ type Relayer struct {
 
 // NewRelayer constructs a Relayer.
 func NewRelayer(ch *Channel, conn *Connection) *Relayer {
+	ch.mutable.RLock()
+	localHostPorts := ch.mutable.relayHostPorts
+	ch.mutable.RUnlock()
+
 	r := &Relayer{
 		relayHost:      ch.RelayHost(),
 		maxTimeout:     ch.relayMaxTimeout,
@@ -249,6 +293,7 @@ func NewRelayer(ch *Channel, conn *Connection) *Relayer {
 		localHandler:   ch.relayLocal,
 		outbound:       newRelayItems(conn.log.WithFields(LogField{"relayItems", "outbound"}), ch.relayMaxTombs),
 		inbound:        newRelayItems(conn.log.WithFields(LogField{"relayItems", "inbound"}), ch.relayMaxTombs),
+		localHostPorts: localHostPorts,
 		peers:          ch.RootPeers(),
 		conn:           conn,
 		relayConn: &relay.Conn{
@@ -404,17 +449,38 @@ func (r *Relayer) getDestination(f *lazyCallReq, call RelayCall) (*Connection, b
 		return nil, false, errBadRelayHost
 	}
 
+	// Relaying a call back to ourselves would loop until the call times out.
+	if _, ok := r.localHostPorts[peer.HostPort()]; ok {
+		r.logger.WithFields(
+			LogField{"id", f.Header.ID},
+			LogField{"source", string(f.Caller())},
+			LogField{"dest", string(f.Service())},
+			LogField{"method", string(f.Method())},
+		).Warn("Relay host selected the relay itself.")
+		call.Failed("relay-loop-detected")
+		r.conn.SendSystemError(f.Header.ID, f.Span(), errRelayLoop)
+		return nil, false, nil
+	}
+
 	remoteConn, err := peer.getConnectionRelay(f.TTL(), r.maxConnTimeout)
 	if err != nil {
 		r.logger.WithFields(
 			ErrField(err),
+			LogField{"id", f.Header.ID},
 			LogField{"source", string(f.Caller())},
 			LogField{"dest", string(f.Service())},
 			LogField{"method", string(f.Method())},
-			LogField{"selectedPeer", peer},
+			LogField{"selectedPeer", peer.HostPort()},
 		).Warn("Failed to connect to relay host.")
 		call.Failed("relay-connection-failed")
-		r.conn.SendSystemError(f.Header.ID, f.Span(), NewWrappedSystemError(ErrCodeNetwork, err))
+
+		// System errors (e.g. timeouts) are forwarded as-is, other errors are
+		// annotated with the destination so the caller knows what failed.
+		connErr := err
+		if _, ok := err.(SystemError); !ok {
+			connErr = NewSystemError(ErrCodeNetwork, "relay failed to connect to %v for service %s: %v", peer.HostPort(), f.Service(), err)
+		}
+		r.conn.SendSystemError(f.Header.ID, f.Span(), connErr)
 		return nil, false, nil
 	}
 
@@ -498,6 +564,8 @@ func (r *Relayer) handleCallReq(f *lazyCallReq) (shouldRelease bool, _ error) {
 	remoteConn.relay.addRelayItem(false /* isOriginator */, destinationID, f.Header.ID, r, ttl, span, call, nil /* mutatedChecksum */)
 	relayToDest := r.addRelayItem(true /* isOriginator */, f.Header.ID, destinationID, remoteConn.relay, ttl, span, call, mutatedChecksum)
 
+	// Checksums only cover the args, so the frame's ID can be rewritten without
+	// recomputing the checksum.
 	f.Header.ID = destinationID
 
 	// If we have appends, the size of the frame to be relayed will change, potentially going
@@ -567,7 +635,9 @@ func (r *Relayer) handleNonCallReq(f *Frame) error {
 
 	sent, failure := item.destination.Receive(f, frameType)
 	if !sent {
-		r.failRelayItem(items, originalID, failure, errFrameNotSent)
+		// The callReq has already been forwarded, so the destination may be handling
+		// the call. Use a code that callers won't retry by default.
+		r.failRelayItem(items, originalID, failure, errContinuationNotSent)
 		return nil
 	}
 
@@ -593,8 +663,7 @@ func (r *Relayer) addRelayItem(isOriginator bool, id, remapID uint32, destinatio
 		items = r.outbound
 	}
 	item.timeout = r.timeouts.Get()
-	items.Add(id, item)
-	item.timeout.Start(ttl, items, id, isOriginator)
+	items.Add(id, item, ttl)
 	return item
 }
 
@@ -633,9 +702,12 @@ func (r *Relayer) failRelayItem(items *relayItems, id uint32, reason string, err
 		return
 	}
 	if item.isOriginator {
-		// If the client is too slow, then there's no point sending an error frame.
-		if reason != _relayErrorSourceConnSlow {
-			r.conn.SendSystemError(id, item.span, fmt.Errorf("%v: %v", reason, err))
+		// If the client is too slow or its connection failed, then there's no point
+		// sending an error frame.
+		if reason != _relayErrorSourceConnSlow && reason != _relayErrorSourceConnFailed {
+			// Keep the code of system errors (e.g. errFrameNotSent) so callers see
+			// the actual failure rather than an unexpected error.
+			r.conn.SendSystemError(id, item.span, NewSystemError(GetSystemErrorCode(err), "%v: %v", reason, GetSystemErrorMessage(err)))
 		}
 		item.call.Failed(reason)
 		item.call.End()
@@ -644,6 +716,41 @@ func (r *Relayer) failRelayItem(items *relayItems, id uint32, reason string, err
 	r.decrementPending()
 }
 
+// failRelayItems fails all calls relayed over this connection, along with the
+// matching relay items on the other side of each call. It's used when this
+// connection has a fatal error, so callers don't have to wait for their calls
+// to time out, and the other connections' pending calls drain.
+func (r *Relayer) failRelayItems(err error) {
+	if r == nil {
+		return
+	}
+
+	// The failure is on the relay's link to a peer, not in the call, so always
+	// report a network error, whatever the connection error's code.
+	connErr := NewSystemError(ErrCodeNetwork, "%v", GetSystemErrorMessage(err))
+
+	// Calls relayed to this connection are failed back to their originators.
+	for _, id := range r.inbound.IDs() {
+		item, _, ok := r.inbound.Get(id, false /* stopTimeout */)
+		if !ok || item.tomb {
+			continue
+		}
+		item.destination.failRelayItem(item.destination.outbound, item.remapID, _relayErrorDestConnFailed, connErr)
+		r.failRelayItem(r.inbound, id, _relayErrorDestConnFailed, connErr)
+	}
+
+	// Calls that originated on this connection can't be answered, but the
+	// destination's items are removed so its pending count drains.
+	for _, id := range r.outbound.IDs() {
+		item, _, ok := r.outbound.Get(id, false /* stopTimeout */)
+		if !ok || item.tomb {
+			continue
+		}
+		item.destination.failRelayItem(item.destination.inbound, item.remapID, _relayErrorSourceConnFailed, connErr)
+		r.failRelayItem(r.outbound, id, _relayErrorSourceConnFailed, connErr)
+	}
+}
+
 func (r *Relayer) finishRelayItem(items *relayItems, id uint32) {
 	item, ok := items.Delete(id)
 	if !ok {
@@ -916,7 +1023,11 @@ func (rfs *relayFragmentSender) flushFragment(wf *writableFragment) error {
 
 	sent, failure := rfs.frameReceiver.Receive(wf.frame, requestFrame)
 	if !sent {
-		rfs.failRelayItemFunc(rfs.outboundRelayItems, rfs.origID, failure, errFrameNotSent)
+		err := errFrameNotSent
+		if wf.frame.Header.messageType != messageTypeCallReq {
+			err = errContinuationNotSent
+		}
+		rfs.failRelayItemFunc(rfs.outboundRelayItems, rfs.origID, failure, err)
 		return nil
 	}
 	return nil
@@ -44,8 +44,10 @@ import (
 	"github.com/uber/tchannel-go/testutils/thriftarg2test"
 	"github.com/uber/tchannel-go/thrift"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
 	"go.uber.org/atomic"
 	"golang.org/x/net/context"
 )
@@ -156,6 +158,93 @@ func TestRelayConnectionCloseDrainsRelayItems(t *testing.T) {
 	})
 }
 
+// connClosingDialer returns a dialer that saves the last connection it dialed,
+// and a function to close that connection.
+func connClosingDialer() (dialer func(context.Context, string, string) (net.Conn, error), closeConn func()) {
+	var (
+		mu   sync.Mutex
+		conn net.Conn
+	)
+	dialer = func(ctx context.Context, network, hostPort string) (net.Conn, error) {
+		c, err := (&net.Dialer{}).DialContext(ctx, network, hostPort)
+		mu.Lock()
+		conn = c
+		mu.Unlock()
+		return c, err
+	}
+	closeConn = func() {
+		mu.Lock()
+		conn.Close()
+		mu.Unlock()
+	}
+	return dialer, closeConn
+}
+
+func TestRelayDestinationConnectionError(t *testing.T) {
+	dialer, closeRelayConn := connClosingDialer()
+	opts := testutils.NewOpts().
+		SetRelayOnly().
+		SetDialer(dialer).
+		// Closing the network connection causes errors on the relay and server.
+		DisableLogVerification()
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		testutils.RegisterFunc(ts.Server(), "close", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			// Close the network connection from the relay to the server mid-call.
+			closeRelayConn()
+			return &raw.Res{}, nil
+		})
+
+		ctx, cancel := NewContext(testutils.Timeout(5 * time.Second))
+		defer cancel()
+
+		client := ts.NewClient(nil)
+		started := time.Now()
+		_, _, _, err := raw.Call(ctx, client, ts.HostPort(), ts.ServiceName(), "close", nil, nil)
+		require.Error(t, err, "Call should fail when the destination connection fails")
+		assert.Equal(t, ErrCodeNetwork, GetSystemErrorCode(err), "Unexpected error code")
+		assert.Contains(t, err.Error(), "relay-dest-conn-failed", "Unexpected error message")
+		assert.True(t, time.Since(started) < testutils.Timeout(time.Second), "Call should fail before its TTL")
+
+		calls := relaytest.NewMockStats()
+		calls.Add(client.PeerInfo().ServiceName, ts.ServiceName(), "close").Failed("relay-dest-conn-failed").End()
+		ts.AssertRelayStats(calls)
+	})
+}
+
+func TestRelaySourceConnectionError(t *testing.T) {
+	opts := testutils.NewOpts().
+		SetRelayOnly().
+		// Closing the network connection causes errors on the client and relay.
+		DisableLogVerification()
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		dialer, closeClientConn := connClosingDialer()
+		client := ts.NewClient(testutils.NewOpts().SetDialer(dialer).DisableLogVerification())
+
+		testutils.RegisterFunc(ts.Server(), "close", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			// Close the network connection from the client to the relay mid-call.
+			closeClientConn()
+
+			// Respond only once the relay has closed its side of the connection, which
+			// requires the call to be cleaned up from the relay to the server connection.
+			closed := testutils.WaitFor(testutils.Timeout(time.Second), func() bool {
+				return ts.Relay().IntrospectNumConnections() == 1
+			})
+			assert.True(t, closed, "Relay should close the failed client connection")
+			return &raw.Res{}, nil
+		})
+
+		ctx, cancel := NewContext(testutils.Timeout(5 * time.Second))
+		defer cancel()
+
+		_, _, _, err := raw.Call(ctx, client, ts.HostPort(), ts.ServiceName(), "close", nil, nil)
+		require.Error(t, err, "Call should fail when the client connection fails")
+
+		calls := relaytest.NewMockStats()
+		calls.Add(client.PeerInfo().ServiceName, ts.ServiceName(), "close").Failed("relay-source-conn-failed").End()
+		ts.AssertRelayStats(calls)
+	})
+}
+
 func TestRelayIDClash(t *testing.T) {
 	opts := serviceNameOpts("s1").SetRelayOnly()
 	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
@@ -242,6 +331,48 @@ func TestRelayErrorsOnGetPeer(t *testing.T) {
 	}
 }
 
+func TestRelayLoopDetected(t *testing.T) {
+	opts := testutils.NewOpts().
+		SetRelayOnly().
+		AddLogFilter("Relay host selected the relay itself.", 1, "dest", "loop")
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		ts.RelayHost().Add("loop", ts.HostPort())
+
+		client := ts.NewClient(nil)
+		err := testutils.CallEcho(client, ts.HostPort(), "loop", nil)
+		require.Error(t, err, "Call to the relay itself should fail")
+		assert.Equal(t, NewSystemError(ErrCodeDeclined, "relay loop detected"), err, "Unexpected error")
+
+		calls := relaytest.NewMockStats()
+		calls.Add(client.PeerInfo().ServiceName, "loop", "echo").Failed("relay-loop-detected").End()
+		ts.AssertRelayStats(calls)
+	})
+}
+
+func TestRelayLoopDetectedUnspecifiedListenAddr(t *testing.T) {
+	opts := testutils.NewOpts().
+		SetListenAddr("0.0.0.0:0").
+		SetRelayOnly().
+		AddLogFilter("Relay host selected the relay itself.", 1, "dest", "loop")
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		// The relay host selects the relay using a routable address rather than the
+		// unspecified address it's listening on.
+		_, port, err := net.SplitHostPort(ts.HostPort())
+		require.NoError(t, err, "Failed to parse relay host:port")
+		relayHostPort := net.JoinHostPort("127.0.0.1", port)
+		ts.RelayHost().Add("loop", relayHostPort)
+
+		client := ts.NewClient(nil)
+		err = testutils.CallEcho(client, relayHostPort, "loop", nil)
+		require.Error(t, err, "Call to the relay itself should fail")
+		assert.Equal(t, NewSystemError(ErrCodeDeclined, "relay loop detected"), err, "Unexpected error")
+
+		calls := relaytest.NewMockStats()
+		calls.Add(client.PeerInfo().ServiceName, "loop", "echo").Failed("relay-loop-detected").End()
+		ts.AssertRelayStats(calls)
+	})
+}
+
 func TestErrorFrameEndsRelay(t *testing.T) {
 	// TestServer validates that there are no relay items left after the given func.
 	opts := serviceNameOpts("svc").SetRelayOnly().DisableLogVerification()
@@ -464,6 +595,7 @@ func TestRelayHandleLocalCall(t *testing.T) {
 		// But an unknown service causes declined
 		err = testutils.CallEcho(client, ts.HostPort(), "unknown", nil)
 		assert.Equal(t, ErrCodeDeclined, GetSystemErrorCode(err), "Expected Declined for unknown")
+		assert.Equal(t, ErrNoPeers.Error(), GetSystemErrorMessage(err), "Unexpected error message for unknown")
 
 		calls := relaytest.NewMockStats()
 		calls.Add(client.ServiceName(), "s2", "echo").Succeeded().End()
@@ -809,6 +941,9 @@ func TestRelayStalledConnection(t *testing.T) {
 
 			_, err := call.Response().Arg2Reader()
 			if assert.Error(t, err, "Expected error while reading") {
+				// The call was already forwarded, so the error must not be retried.
+				assert.Equal(t, ErrCodeUnexpected, GetSystemErrorCode(err), "Unexpected error code")
+				assert.False(t, RetryDefault.CanRetry(err), "Dropped continuation should not be retried")
 				assert.Contains(t, err.Error(), "frame was not sent to remote side")
 			}
 		}()
@@ -1271,6 +1406,44 @@ func TestRelayThriftArg2KeyValueIteration(t *testing.T) {
 	})
 }
 
+func TestRelayPreservesTracing(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("relay-tracing", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	opts := testutils.NewOpts().SetRelayOnly()
+	opts.ChannelOptions.Tracer = tracer
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		gotSpan := make(chan Span, 1)
+		testutils.RegisterFunc(ts.Server(), "trace", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			gotSpan <- *CurrentSpan(ctx)
+			return &raw.Res{}, nil
+		})
+
+		clientOpts := testutils.NewOpts()
+		clientOpts.ChannelOptions.Tracer = tracer
+		client := ts.NewClient(clientOpts)
+
+		span := tracer.StartSpan("client")
+		defer span.Finish()
+
+		ctx, cancel := NewContextBuilder(testutils.Timeout(time.Second)).
+			SetParentContext(opentracing.ContextWithSpan(context.Background(), span)).
+			Build()
+		defer cancel()
+
+		_, _, _, err := raw.Call(ctx, client, ts.HostPort(), ts.ServiceName(), "trace", nil, nil)
+		require.NoError(t, err, "Relayed call failed")
+
+		root := CurrentSpan(ctx)
+		require.NotZero(t, root.TraceID(), "Expected the client span to have a trace ID")
+
+		// The relay rewrites the frame ID, but must leave the tracing fields intact.
+		serverSpan := <-gotSpan
+		assert.Equal(t, root.TraceID(), serverSpan.TraceID(), "Trace ID changed across the relay")
+		assert.NotEqual(t, root.SpanID(), serverSpan.SpanID(), "Server should have its own span")
+	})
+}
+
 func TestRelayConnectionTimeout(t *testing.T) {
 	var (
 		minTimeout = testutils.Timeout(10 * time.Millisecond)
@@ -1337,6 +1510,34 @@ func TestRelayConnectionTimeout(t *testing.T) {
 	}
 }
 
+func TestRelayConnectionFailed(t *testing.T) {
+	// Get a host:port that nothing is listening on, so connections are refused.
+	deadHostPort := testutils.GetClosedHostPort(t)
+
+	opts := testutils.NewOpts().
+		SetRelayOnly().
+		AddLogFilter("Failed to connect to relay host.", 1,
+			"selectedPeer", deadHostPort, "dest", "dead")
+	testutils.WithTestServer(t, opts, func(t testing.TB, ts *testutils.TestServer) {
+		ts.RelayHost().Add("dead", deadHostPort)
+
+		client := ts.NewClient(nil)
+		err := testutils.CallEcho(client, ts.HostPort(), "dead", nil)
+		require.Error(t, err, "Call to unreachable peer should fail")
+
+		se, ok := err.(SystemError)
+		require.True(t, ok, "err should be a SystemError, got %T", err)
+		assert.Equal(t, ErrCodeNetwork, se.Code(), "Unexpected error code")
+		assert.Contains(t, se.Message(), deadHostPort, "Error should include the destination host:port")
+		assert.Contains(t, se.Message(), "dead", "Error should include the destination service")
+
+		calls := relaytest.NewMockStats()
+		calls.Add(client.PeerInfo().ServiceName, "dead", "echo").
+			Failed("relay-connection-failed").End()
+		ts.AssertRelayStats(calls)
+	})
+}
+
 func TestRelayTransferredBytes(t *testing.T) {
 	const (
 		kb = 1024
@@ -37,7 +37,7 @@ import (
 func NewServerChannel(opts *ChannelOpts) (*tchannel.Channel, error) {
 	opts = opts.Copy()
 
-	l, err := net.Listen("tcp", "127.0.0.1:0")
+	l, err := net.Listen("tcp", defaultString(opts.ListenAddr, "127.0.0.1:0"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen: %v", err)
 	}
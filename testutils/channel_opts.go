@@ -48,6 +48,10 @@ type ChannelOpts struct {
 	// ServiceName defaults to DefaultServerName or DefaultClientName.
 	ServiceName string
 
+	// ListenAddr is the host:port that server channels listen on.
+	// It defaults to "127.0.0.1:0".
+	ListenAddr string
+
 	// LogVerification contains options for controlling the log verification.
 	LogVerification LogVerification
 
@@ -107,6 +111,12 @@ func (o *ChannelOpts) SetServiceName(svcName string) *ChannelOpts {
 	return o
 }
 
+// SetListenAddr sets ListenAddr.
+func (o *ChannelOpts) SetListenAddr(hostPort string) *ChannelOpts {
+	o.ListenAddr = hostPort
+	return o
+}
+
 // SetProcessName sets the ProcessName in ChannelOptions.
 func (o *ChannelOpts) SetProcessName(processName string) *ChannelOpts {
 	o.ProcessName = processName